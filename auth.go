@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	KindClientAuth    = 22242
+	AuthChallengeSkew = 10 * time.Minute
+)
+
+// connState tracks NIP-42 AUTH state for a single WebSocket connection: the
+// challenge handed to the client on connect, and the pubkey it authenticated
+// as once AUTH succeeds.
+type connState struct {
+	mu        sync.Mutex
+	challenge string
+	pubkey    string
+}
+
+func newConnState() *connState {
+	return &connState{challenge: newAuthChallenge()}
+}
+
+func newAuthChallenge() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func (s *connState) Challenge() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.challenge
+}
+
+func (s *connState) Pubkey() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pubkey
+}
+
+func (s *connState) setPubkey(pubkey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pubkey = pubkey
+}
+
+// ClientAuthMsgJSON is the client's response to an AUTH challenge: a signed
+// kind-22242 event carrying "challenge" and "relay" tags.
+type ClientAuthMsgJSON struct {
+	EventJSON *EventJSON
+}
+
+// ServerAuthMsg is the server-initiated `["AUTH", <challenge>]` frame sent
+// once per connection.
+type ServerAuthMsg struct {
+	Challenge string
+}
+
+func (msg *ServerAuthMsg) MarshalJSON() ([]byte, error) {
+	return json.Marshal([2]string{"AUTH", msg.Challenge})
+}
+
+// serveClientAuthMsgJSON validates msg against the challenge issued to this
+// connection and, on success, records the authenticated pubkey on state.
+func serveClientAuthMsgJSON(req *http.Request, state *connState, msg *ClientAuthMsgJSON) error {
+	pubkey, err := validateAuthEvent(req, state.Challenge(), msg.EventJSON)
+	if err != nil {
+		return fmt.Errorf("auth failed: %w", err)
+	}
+
+	state.setPubkey(pubkey)
+	return nil
+}
+
+// validateAuthEvent checks the cheap, synchronous conditions first (kind,
+// created_at skew, challenge, relay host) before falling through to
+// signature verification, which is the only check that requires doing
+// actual crypto work.
+func validateAuthEvent(req *http.Request, challenge string, eventJSON *EventJSON) (string, error) {
+	if eventJSON.Kind != KindClientAuth {
+		return "", fmt.Errorf("auth event has wrong kind: %v", eventJSON.Kind)
+	}
+
+	createdAt := time.Unix(eventJSON.CreatedAt, 0)
+	if skew := time.Since(createdAt); skew > AuthChallengeSkew || skew < -AuthChallengeSkew {
+		return "", fmt.Errorf("auth event created_at out of range: %v", eventJSON.CreatedAt)
+	}
+
+	var gotChallenge, gotRelay string
+	for _, tag := range eventJSON.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "challenge":
+			gotChallenge = tag[1]
+		case "relay":
+			gotRelay = tag[1]
+		}
+	}
+
+	if subtle.ConstantTimeCompare([]byte(gotChallenge), []byte(challenge)) != 1 {
+		return "", fmt.Errorf("auth event challenge mismatch")
+	}
+
+	relayURL, err := url.Parse(gotRelay)
+	if err != nil {
+		return "", fmt.Errorf("auth event relay tag is not a url: %w", err)
+	}
+	if relayURL.Host != req.Host {
+		return "", fmt.Errorf("auth event relay host mismatch: %v != %v", relayURL.Host, req.Host)
+	}
+
+	ok, err := eventJSON.Verify()
+	if err != nil {
+		return "", fmt.Errorf("failed to verify auth event: %w", err)
+	}
+	if !ok {
+		return "", fmt.Errorf("invalid auth event signature")
+	}
+
+	return eventJSON.PubKey, nil
+}
+
+// Policy gates reads and writes by the pubkey a connection authenticated as
+// via NIP-42 AUTH. An unauthenticated connection is consulted with an empty
+// pubkey.
+type Policy interface {
+	CanWrite(pubkey string, event *Event) error
+	CanRead(pubkey string, filters Filters) error
+}
+
+// AllowAllPolicy is the default Policy: every connection, authenticated or
+// not, may read and write.
+type AllowAllPolicy struct{}
+
+func (AllowAllPolicy) CanWrite(pubkey string, event *Event) error   { return nil }
+func (AllowAllPolicy) CanRead(pubkey string, filters Filters) error { return nil }
+
+// RequireAuthForWritePolicy rejects EVENT from connections that have not
+// completed NIP-42 AUTH. Reads remain unrestricted.
+type RequireAuthForWritePolicy struct{}
+
+func (RequireAuthForWritePolicy) CanWrite(pubkey string, event *Event) error {
+	if pubkey == "" {
+		return fmt.Errorf("auth required to publish events")
+	}
+	return nil
+}
+
+func (RequireAuthForWritePolicy) CanRead(pubkey string, filters Filters) error { return nil }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestValidateAuthEvent(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://relay.example/", nil)
+	req.Host = "relay.example"
+
+	now := time.Now()
+	validTags := [][]string{
+		{"challenge", "abc123"},
+		{"relay", "wss://relay.example/"},
+	}
+
+	tests := []struct {
+		name      string
+		challenge string
+		event     *EventJSON
+	}{
+		{
+			name:      "wrong kind",
+			challenge: "abc123",
+			event: &EventJSON{
+				Kind:      1,
+				CreatedAt: now.Unix(),
+				Tags:      validTags,
+			},
+		},
+		{
+			name:      "created_at too old",
+			challenge: "abc123",
+			event: &EventJSON{
+				Kind:      KindClientAuth,
+				CreatedAt: now.Add(-2 * AuthChallengeSkew).Unix(),
+				Tags:      validTags,
+			},
+		},
+		{
+			name:      "created_at too far in the future",
+			challenge: "abc123",
+			event: &EventJSON{
+				Kind:      KindClientAuth,
+				CreatedAt: now.Add(2 * AuthChallengeSkew).Unix(),
+				Tags:      validTags,
+			},
+		},
+		{
+			name:      "challenge mismatch",
+			challenge: "some-other-challenge",
+			event: &EventJSON{
+				Kind:      KindClientAuth,
+				CreatedAt: now.Unix(),
+				Tags:      validTags,
+			},
+		},
+		{
+			name:      "relay host mismatch",
+			challenge: "abc123",
+			event: &EventJSON{
+				Kind:      KindClientAuth,
+				CreatedAt: now.Unix(),
+				Tags: [][]string{
+					{"challenge", "abc123"},
+					{"relay", "wss://not-the-relay.example/"},
+				},
+			},
+		},
+		{
+			name:      "bad signature",
+			challenge: "abc123",
+			event: &EventJSON{
+				Kind:      KindClientAuth,
+				CreatedAt: now.Unix(),
+				Tags:      validTags,
+				Sig:       "0000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := validateAuthEvent(req, tt.challenge, tt.event); err == nil {
+				t.Fatalf("validateAuthEvent() = nil error, want rejection")
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ClientCountMsgJSON is a NIP-45 `["COUNT", <sub_id>, <filters...>]` request.
+// Unlike REQ it is one-shot: it is never registered with the router.
+type ClientCountMsgJSON struct {
+	SubscriptionID string
+	FilterJSONs    []*FilterJSON
+}
+
+// ServerCountMsg is the `["COUNT", <sub_id>, {"count": N}]` reply to a
+// ClientCountMsgJSON.
+type ServerCountMsg struct {
+	SubscriptionID string
+	Count          int
+}
+
+func (msg *ServerCountMsg) MarshalJSON() ([]byte, error) {
+	return json.Marshal([3]any{"COUNT", msg.SubscriptionID, countPayload{msg.Count}})
+}
+
+type countPayload struct {
+	Count int `json:"count"`
+}
+
+// serveClientCountMsgJSON answers a COUNT request with just the cardinality
+// of matching events, never materializing them into sender.
+func serveClientCountMsgJSON(
+	db *DB,
+	policy Policy,
+	pubkey string,
+	sender chan<- ServerMsg,
+	msg *ClientCountMsgJSON,
+) error {
+	filters := NewFiltersFromFilterJSONs(msg.FilterJSONs)
+
+	if len(filters) > MaxFilterLen+2 {
+		return fmt.Errorf("filter is too long: %v", msg)
+	}
+
+	if err := policy.CanRead(pubkey, filters); err != nil {
+		return fmt.Errorf("read rejected by policy: %w", err)
+	}
+
+	count, err := db.Count(filters)
+	if err != nil {
+		return fmt.Errorf("failed to count events: %w", err)
+	}
+
+	sender <- &ServerCountMsg{msg.SubscriptionID, count}
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	_ "net/http/pprof"
@@ -20,6 +21,7 @@ const (
 	DefaultAddr         = ":80"
 	DefaultClientMsgLen = 1048576
 	DefaultPprofAddr    = ":8396"
+	DefaultStore        = "memory"
 )
 
 var DBSize = flag.Int("db", DefaultDBSize, "in-memory db size")
@@ -27,6 +29,8 @@ var Addr = flag.String("addr", DefaultAddr, "relay addr")
 var PprofAddr = flag.String("pprof", DefaultPprofAddr, "relay addr")
 var MaxClientMesLen = flag.Int("msglen", DefaultClientMsgLen, "max client message length")
 var Verbose = flag.Bool("v", false, "enable verbose log")
+var StoreDSN = flag.String("store", DefaultStore, "storage backend: \"memory\" or \"sqlite:///path/to/relay.db\"")
+var RequireAuthForWrite = flag.Bool("require-auth-for-write", false, "reject EVENT from connections that have not completed NIP-42 AUTH")
 
 var DefaultFilters = Filters{&Filter{&FilterJSON{Kinds: &[]int{
 	0, 1, 6, 7,
@@ -49,7 +53,10 @@ func init() {
 func main() {
 	logStdout.Printf("server start")
 
-	go http.ListenAndServe(*PprofAddr, nil)
+	pprofMux := http.NewServeMux()
+	pprofMux.Handle("/", http.DefaultServeMux)
+	RegisterMetrics(pprofMux)
+	go http.ListenAndServe(*PprofAddr, pprofMux)
 
 	if err := Run(context.Background()); err != nil {
 		logStderr.Fatalf("server terminated with error: %v", err)
@@ -63,7 +70,17 @@ func Run(ctx context.Context) error {
 	defer stop()
 
 	router := NewRouter(DefaultFilters)
-	db := NewDB(*DBSize, DefaultFilters)
+
+	store, err := NewStoreFromFlag(*StoreDSN, *DBSize, DefaultFilters)
+	if err != nil {
+		return fmt.Errorf("failed to build store: %w", err)
+	}
+	db := NewDB(store)
+
+	var policy Policy = AllowAllPolicy{}
+	if *RequireAuthForWrite {
+		policy = RequireAuthForWritePolicy{}
+	}
 
 	mux := http.NewServeMux()
 
@@ -79,6 +96,14 @@ func Run(ctx context.Context) error {
 				return
 			}
 
+		case "text/event-stream":
+			logStdout.Printf("[%v]: connect sse", connID)
+			defer logStdout.Printf("[%v]: disconnect sse", connID)
+
+			if err := HandleSSE(sigCtx, w, r, connID, router, db, policy); err != nil {
+				logStderr.Printf("[%v]: sse error: %v", connID, err)
+			}
+
 		default:
 			conn, _, _, err := ws.UpgradeHTTP(r, w)
 			if err != nil {
@@ -90,7 +115,7 @@ func Run(ctx context.Context) error {
 			logStdout.Printf("[%v]: connect websocket", connID)
 			defer logStdout.Printf("[%v]: disconnect websocket", connID)
 
-			if err := HandleWebsocket(r.Context(), r, connID, conn, router, db); err != nil {
+			if err := HandleWebsocket(r.Context(), r, connID, conn, router, db, policy); err != nil {
 				logStderr.Printf("[%v]: websocket error: %v", connID, err)
 			}
 		}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	metricsActiveConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mocrelay",
+		Name:      "active_websocket_connections",
+		Help:      "Number of currently open WebSocket connections.",
+	})
+
+	metricsActiveSubscriptions = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "mocrelay",
+		Name:      "active_subscriptions_per_connection",
+		Help:      "Active subscriptions on a connection, observed each time a REQ registers a subscription.",
+		Buckets:   prometheus.LinearBuckets(1, 1, 10),
+	})
+
+	metricsMessagesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mocrelay",
+		Name:      "client_messages_total",
+		Help:      "Client messages processed, labelled by message type and result.",
+	}, []string{"type", "result"})
+
+	metricsBytesIn = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "mocrelay",
+		Name:      "bytes_in_total",
+		Help:      "Bytes read from WebSocket frames.",
+	})
+
+	metricsBytesOut = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "mocrelay",
+		Name:      "bytes_out_total",
+		Help:      "Bytes written to WebSocket frames.",
+	})
+
+	metricsEOSELatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "mocrelay",
+		Name:      "eose_latency_seconds",
+		Help:      "Time from REQ arrival to EOSE being sent.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	metricsFindAllDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "mocrelay",
+		Name:      "db_find_all_duration_seconds",
+		Help:      "Duration of the DB backlog replay servicing a REQ.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	metricsRouterFanout = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "mocrelay",
+		Name:      "router_publish_fanout",
+		Help:      "Number of subscriptions a published event was delivered to.",
+		Buckets:   prometheus.LinearBuckets(0, 5, 10),
+	})
+
+	metricsRateLimiterDrops = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "mocrelay",
+		Name:      "rate_limiter_drops_total",
+		Help:      "Messages dropped because the per-connection rate limiter could not be satisfied.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		metricsActiveConnections,
+		metricsActiveSubscriptions,
+		metricsMessagesTotal,
+		metricsBytesIn,
+		metricsBytesOut,
+		metricsEOSELatency,
+		metricsFindAllDuration,
+		metricsRouterFanout,
+		metricsRateLimiterDrops,
+	)
+}
+
+// RegisterMetrics mounts the Prometheus handler at /metrics on mux, giving
+// load tests real observability alongside the pprof debug plane.
+func RegisterMetrics(mux *http.ServeMux) {
+	mux.Handle("/metrics", promhttp.Handler())
+}
+
+func observeClientMsg(msgType, result string) {
+	metricsMessagesTotal.WithLabelValues(msgType, result).Inc()
+}
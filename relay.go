@@ -24,7 +24,7 @@ const (
 	MaxFilterLen   = 50
 )
 
-func HandleWebsocket(ctx context.Context, req *http.Request, connID string, conn net.Conn, router *Router, db *DB) error {
+func HandleWebsocket(ctx context.Context, req *http.Request, connID string, conn net.Conn, router *Router, db *DB, policy Policy) error {
 	defer func() {
 		if err := recover(); err != nil {
 			logStderr.Printf("[%v, %v]: paniced: %v", req.RemoteAddr, connID, err)
@@ -34,7 +34,11 @@ func HandleWebsocket(ctx context.Context, req *http.Request, connID string, conn
 
 	defer router.Delete(connID)
 
+	metricsActiveConnections.Inc()
+	defer metricsActiveConnections.Dec()
+
 	sender := make(chan ServerMsg, SenderLen)
+	state := newConnState()
 
 	errCh := make(chan error, 2)
 
@@ -47,13 +51,13 @@ func HandleWebsocket(ctx context.Context, req *http.Request, connID string, conn
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		errCh <- wsSender(ctx, req, connID, conn, router, sender)
+		errCh <- wsSender(ctx, req, connID, conn, router, sender, state)
 	}()
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		errCh <- wsReceiver(ctx, req, connID, conn, router, db, sender)
+		errCh <- wsReceiver(ctx, req, connID, conn, router, db, sender, state, policy)
 	}()
 
 	err := <-errCh
@@ -76,19 +80,25 @@ func wsReceiver(
 	router *Router,
 	db *DB,
 	sender chan<- ServerMsg,
+	state *connState,
+	policy Policy,
 ) error {
 	lim := rate.NewLimiter(RateLimitRate, RateLimitBurst)
 	reader := wsutil.NewServerSideReader(conn)
 
 	for {
-		if err := lim.Wait(ctx); err != nil {
-			return fmt.Errorf("rate limiter returns error: %w", err)
-		}
-
 		payload, err := wsRead(reader)
 		if err != nil {
 			return fmt.Errorf("receive error: %w", err)
 		}
+		metricsBytesIn.Add(float64(len(payload)))
+
+		if !lim.Allow() {
+			metricsRateLimiterDrops.Inc()
+			observeClientMsg("unknown", "rate_limited")
+			logStderr.Printf("[%v, %v]: dropped message: rate limit exceeded", req.RemoteAddr, connID)
+			continue
+		}
 
 		if !utf8.Valid(payload) {
 			logStderr.Printf("[%v, %v]: payload is not utf8: %v", req.RemoteAddr, connID, payload)
@@ -98,6 +108,7 @@ func wsReceiver(
 		strMsg := string(payload)
 		jsonMsg, err := ParseClientMsgJSON(strMsg)
 		if err != nil {
+			observeClientMsg("unknown", "invalid")
 			logStderr.Printf("[%v, %v]: received invalid msg: %v", req.RemoteAddr, connID, err)
 			continue
 		}
@@ -106,22 +117,44 @@ func wsReceiver(
 
 		switch msg := jsonMsg.(type) {
 		case *ClientReqMsgJSON:
-			if err := serveClientReqMsgJSON(connID, router, db, sender, msg); err != nil {
+			if err := serveClientReqMsgJSON(connID, router, db, policy, state.Pubkey(), sender, msg); err != nil {
+				observeClientMsg("REQ", "invalid")
 				logStderr.Printf("[%v, %v]: failed to serve client req msg %v", req.RemoteAddr, connID, err)
 				continue
 			}
+			observeClientMsg("REQ", "ok")
 
 		case *ClientCloseMsgJSON:
 			if err := serveClientCloseMsgJSON(connID, router, msg); err != nil {
+				observeClientMsg("CLOSE", "invalid")
 				logStderr.Printf("[%v, %v]: failed to serve client close msg %v", req.RemoteAddr, connID, err)
 				continue
 			}
+			observeClientMsg("CLOSE", "ok")
 
 		case *ClientEventMsgJSON:
-			if err := serveClientEventMsgJSON(router, db, msg); err != nil {
+			if err := serveClientEventMsgJSON(router, db, policy, state.Pubkey(), msg); err != nil {
+				observeClientMsg("EVENT", "invalid")
 				logStderr.Printf("[%v, %v]: failed to serve client event msg %v", req.RemoteAddr, connID, err)
 				continue
 			}
+			observeClientMsg("EVENT", "ok")
+
+		case *ClientAuthMsgJSON:
+			if err := serveClientAuthMsgJSON(req, state, msg); err != nil {
+				observeClientMsg("AUTH", "invalid")
+				logStderr.Printf("[%v, %v]: failed to serve client auth msg %v", req.RemoteAddr, connID, err)
+				continue
+			}
+			observeClientMsg("AUTH", "ok")
+
+		case *ClientCountMsgJSON:
+			if err := serveClientCountMsgJSON(db, policy, state.Pubkey(), sender, msg); err != nil {
+				observeClientMsg("COUNT", "invalid")
+				logStderr.Printf("[%v, %v]: failed to serve client count msg %v", req.RemoteAddr, connID, err)
+				continue
+			}
+			observeClientMsg("COUNT", "ok")
 		}
 	}
 }
@@ -145,25 +178,53 @@ func wsRead(wsr *wsutil.Reader) ([]byte, error) {
 	return res, err
 }
 
+// serveClientReqMsgJSON subscribes before replaying the backlog so that no
+// event published between the DB snapshot and the subscribe call is lost.
+// router.Subscribe registers the sender immediately but holds live events
+// back until sub.EOSE is called; events the historical cursor has already
+// handed to sender are marked via sub.MarkReplayed so the router can drop
+// the duplicate when it later flushes its buffered live events.
 func serveClientReqMsgJSON(
 	connID string,
 	router *Router,
 	db *DB,
+	policy Policy,
+	pubkey string,
 	sender chan<- ServerMsg,
 	msg *ClientReqMsgJSON,
 ) error {
+	reqStart := time.Now()
+
 	filters := NewFiltersFromFilterJSONs(msg.FilterJSONs)
 
 	if len(filters) > MaxFilterLen+2 {
 		return fmt.Errorf("filter is too long: %v", msg)
 	}
 
-	for _, event := range db.FindAll(filters) {
+	if err := policy.CanRead(pubkey, filters); err != nil {
+		return fmt.Errorf("read rejected by policy: %w", err)
+	}
+
+	sub := router.Subscribe(connID, msg.SubscriptionID, filters, sender)
+	metricsActiveSubscriptions.Observe(float64(router.SubscriptionCount(connID)))
+
+	findAllStart := time.Now()
+	if err := db.Iterate(filters, func(event *Event) bool {
+		if !sub.MarkReplayed(event.EventJSON.ID) {
+			return true
+		}
 		sender <- &ServerEventMsg{msg.SubscriptionID, event.EventJSON}
+		return true
+	}); err != nil {
+		return fmt.Errorf("failed to iterate db: %w", err)
 	}
+	metricsFindAllDuration.Observe(time.Since(findAllStart).Seconds())
+
 	sender <- &ServerEOSEMsg{msg.SubscriptionID}
+	metricsEOSELatency.Observe(time.Since(reqStart).Seconds())
+
+	sub.EOSE()
 
-	router.Subscribe(connID, msg.SubscriptionID, filters, sender)
 	return nil
 }
 
@@ -174,7 +235,7 @@ func serveClientCloseMsgJSON(connID string, router *Router, msg *ClientCloseMsgJ
 	return nil
 }
 
-func serveClientEventMsgJSON(router *Router, db *DB, msg *ClientEventMsgJSON) error {
+func serveClientEventMsgJSON(router *Router, db *DB, policy Policy, pubkey string, msg *ClientEventMsgJSON) error {
 	ok, err := msg.EventJSON.Verify()
 	if err != nil {
 		return fmt.Errorf("failed to verify event json: %v", msg)
@@ -186,11 +247,19 @@ func serveClientEventMsgJSON(router *Router, db *DB, msg *ClientEventMsgJSON) er
 
 	event := &Event{msg.EventJSON, time.Now()}
 
-	db.Save(event)
+	if err := policy.CanWrite(pubkey, event); err != nil {
+		return fmt.Errorf("write rejected by policy: %w", err)
+	}
 
-	if err := router.Publish(event); err != nil {
+	if err := db.Save(event); err != nil {
+		return fmt.Errorf("failed to save event: %w", err)
+	}
+
+	fanout, err := router.Publish(event)
+	if err != nil {
 		return fmt.Errorf("failed to publish event: %v", event)
 	}
+	metricsRouterFanout.Observe(float64(fanout))
 	return nil
 }
 
@@ -201,6 +270,7 @@ func wsSender(
 	conn net.Conn,
 	router *Router,
 	sender <-chan ServerMsg,
+	state *connState,
 ) (err error) {
 	defer func() {
 		if _, e := conn.Write(ws.CompiledCloseNormalClosure); e != nil {
@@ -211,6 +281,17 @@ func wsSender(
 		}
 	}()
 
+	authMsg := &ServerAuthMsg{Challenge: state.Challenge()}
+	authJSON, err := authMsg.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal auth challenge: %w", err)
+	}
+	if err := wsutil.WriteServerText(conn, authJSON); err != nil {
+		return fmt.Errorf("failed to send auth challenge: %w", err)
+	}
+	metricsBytesOut.Add(float64(len(authJSON)))
+	DoAccessLog(req.RemoteAddr, connID, AccessLogSend, string(authJSON))
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -228,6 +309,7 @@ func wsSender(
 				}
 				return fmt.Errorf("failed to write server text: %w", err)
 			}
+			metricsBytesOut.Add(float64(len(jsonMsg)))
 
 			DoAccessLog(req.RemoteAddr, connID, AccessLogSend, string(jsonMsg))
 		}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	SSEKeepaliveInterval = 25 * time.Second
+)
+
+// sseRequest holds the filter list of an SSE subscription, same as the REQ
+// message's filter list. A GET passes it as a `filters` query parameter
+// holding a JSON array of filter objects; a POST body is a JSON object whose
+// "filters" field holds that array.
+type sseRequest struct {
+	Filters []*FilterJSON `json:"filters"`
+}
+
+// HandleSSE serves a long-lived text/event-stream subscription: it replays
+// matching historical events from db, emits an EOSE comment, then streams
+// live events from router until the client disconnects. It honors the same
+// MaxFilterLen cap, rate limiter, and Policy.CanRead gate as the WebSocket
+// REQ path.
+func HandleSSE(ctx context.Context, w http.ResponseWriter, req *http.Request, connID string, router *Router, db *DB, policy Policy) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("streaming not supported")
+	}
+
+	sseReq, err := parseSSERequest(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return fmt.Errorf("failed to parse sse request: %w", err)
+	}
+
+	filters := NewFiltersFromFilterJSONs(sseReq.Filters)
+	if len(filters) > MaxFilterLen+2 {
+		http.Error(w, "filter is too long", http.StatusBadRequest)
+		return fmt.Errorf("filter is too long: %v", sseReq)
+	}
+
+	lim := rate.NewLimiter(RateLimitRate, RateLimitBurst)
+	if err := lim.Wait(req.Context()); err != nil {
+		return fmt.Errorf("rate limiter returns error: %w", err)
+	}
+
+	// SSE has no AUTH handshake, so it is always consulted as unauthenticated.
+	if err := policy.CanRead("", filters); err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return fmt.Errorf("read rejected by policy: %w", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	subID := connID
+
+	sender := make(chan ServerMsg, SenderLen)
+	defer router.Delete(connID)
+
+	sub := router.Subscribe(connID, subID, filters, sender)
+
+	var writeErr error
+	if err := db.Iterate(filters, func(event *Event) bool {
+		if !sub.MarkReplayed(event.EventJSON.ID) {
+			return true
+		}
+		if writeErr = writeSSEEvent(w, &ServerEventMsg{subID, event.EventJSON}); writeErr != nil {
+			return false
+		}
+		return true
+	}); err != nil {
+		return fmt.Errorf("failed to iterate db: %w", err)
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	if _, err := io.WriteString(w, ": eose\n\n"); err != nil {
+		return fmt.Errorf("failed to write eose comment: %w", err)
+	}
+	flusher.Flush()
+
+	sub.EOSE()
+
+	ticker := time.NewTicker(SSEKeepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-req.Context().Done():
+			return nil
+
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return fmt.Errorf("failed to write keepalive: %w", err)
+			}
+			flusher.Flush()
+
+		case msg := <-sender:
+			if err := writeSSEEvent(w, msg); err != nil {
+				return err
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSSEEvent(w http.ResponseWriter, msg ServerMsg) error {
+	jsonMsg, err := msg.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal server msg: %w", err)
+	}
+	if _, err := fmt.Fprintf(w, "data: %s\n\n", jsonMsg); err != nil {
+		return fmt.Errorf("failed to write sse frame: %w", err)
+	}
+	return nil
+}
+
+func parseSSERequest(req *http.Request) (*sseRequest, error) {
+	if req.Method == http.MethodPost {
+		var sseReq sseRequest
+		if err := json.NewDecoder(req.Body).Decode(&sseReq); err != nil {
+			return nil, fmt.Errorf("failed to decode sse request body: %w", err)
+		}
+		return &sseReq, nil
+	}
+
+	q := req.URL.Query().Get("filters")
+	if q == "" {
+		return &sseRequest{}, nil
+	}
+
+	var filterJSONs []*FilterJSON
+	if err := json.Unmarshal([]byte(q), &filterJSONs); err != nil {
+		return nil, fmt.Errorf("failed to decode filters query param: %w", err)
+	}
+	return &sseRequest{Filters: filterJSONs}, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Store is the persistence backend that DB delegates to. Implementations
+// must be safe for concurrent use; DB itself holds no locks of its own.
+type Store interface {
+	Save(event *Event) error
+	FindAll(filters Filters) []*Event
+	Iterate(filters Filters, fn func(*Event) bool) error
+	Count(filters Filters) (int, error)
+	Delete(id string) error
+	ReplaceableUpsert(event *Event) error
+}
+
+// DB is a thin wrapper around a pluggable Store. It exists so that callers
+// (relay.go, sse.go) depend on a stable type regardless of which Store
+// backs a given deployment.
+type DB struct {
+	store Store
+}
+
+// NewDB wraps store behind the DB type used throughout the relay.
+func NewDB(store Store) *DB {
+	return &DB{store: store}
+}
+
+func (db *DB) Save(event *Event) error {
+	return db.store.Save(event)
+}
+
+func (db *DB) FindAll(filters Filters) []*Event {
+	return db.store.FindAll(filters)
+}
+
+func (db *DB) Iterate(filters Filters, fn func(*Event) bool) error {
+	return db.store.Iterate(filters, fn)
+}
+
+func (db *DB) Count(filters Filters) (int, error) {
+	return db.store.Count(filters)
+}
+
+func (db *DB) Delete(id string) error {
+	return db.store.Delete(id)
+}
+
+func (db *DB) ReplaceableUpsert(event *Event) error {
+	return db.store.ReplaceableUpsert(event)
+}
+
+// memoryStore is the original in-memory ring buffer, capped at size events
+// and restricted up front to DefaultFilters so unbounded kinds can't blow
+// out memory.
+type memoryStore struct {
+	mu     sync.Mutex
+	size   int
+	allow  Filters
+	events []*Event
+	byID   map[string]int
+}
+
+// NewMemoryStore returns a Store that keeps at most size events in memory,
+// evicting the oldest once full. allow restricts what Save will accept.
+func NewMemoryStore(size int, allow Filters) Store {
+	return &memoryStore{
+		size:  size,
+		allow: allow,
+		byID:  make(map[string]int),
+	}
+}
+
+func (s *memoryStore) Save(event *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.allow.Match(event.EventJSON) {
+		return fmt.Errorf("event kind not allowed: %v", event.EventJSON.ID)
+	}
+
+	if _, ok := s.byID[event.EventJSON.ID]; ok {
+		return nil
+	}
+
+	s.events = append(s.events, event)
+	s.byID[event.EventJSON.ID] = len(s.events) - 1
+
+	if len(s.events) > s.size {
+		evicted := s.events[0]
+		s.events = s.events[1:]
+		delete(s.byID, evicted.EventJSON.ID)
+		for id, idx := range s.byID {
+			s.byID[id] = idx - 1
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) FindAll(filters Filters) []*Event {
+	var found []*Event
+	s.Iterate(filters, func(event *Event) bool {
+		found = append(found, event)
+		return true
+	})
+	return found
+}
+
+// Iterate replays events newest-first, the nostr convention and the same
+// order sqliteStore's `ORDER BY created_at DESC` produces, so REQ/SSE
+// replay ordering doesn't change with -store.
+func (s *memoryStore) Iterate(filters Filters, fn func(*Event) bool) error {
+	s.mu.Lock()
+	snapshot := make([]*Event, len(s.events))
+	copy(snapshot, s.events)
+	s.mu.Unlock()
+
+	sort.Slice(snapshot, func(i, j int) bool {
+		return snapshot[i].EventJSON.CreatedAt > snapshot[j].EventJSON.CreatedAt
+	})
+
+	for _, event := range snapshot {
+		if !filters.Match(event.EventJSON) {
+			continue
+		}
+		if !fn(event) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) Count(filters Filters) (int, error) {
+	n := 0
+	s.Iterate(filters, func(event *Event) bool {
+		n++
+		return true
+	})
+	return n, nil
+}
+
+func (s *memoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx, ok := s.byID[id]
+	if !ok {
+		return nil
+	}
+
+	s.events = append(s.events[:idx], s.events[idx+1:]...)
+	delete(s.byID, id)
+	for otherID, otherIdx := range s.byID {
+		if otherIdx > idx {
+			s.byID[otherID] = otherIdx - 1
+		}
+	}
+	return nil
+}
+
+// ReplaceableUpsert keeps at most one event per (pubkey, kind). Save only
+// deduplicates by id, so more than one matching event can already be
+// present; every one of them is deleted rather than assuming just one.
+func (s *memoryStore) ReplaceableUpsert(event *Event) error {
+	s.mu.Lock()
+	var maxCreatedAt int64
+	var haveExisting bool
+	var matchingIDs []string
+	for id, idx := range s.byID {
+		existing := s.events[idx]
+		if existing.EventJSON.PubKey != event.EventJSON.PubKey ||
+			existing.EventJSON.Kind != event.EventJSON.Kind {
+			continue
+		}
+		matchingIDs = append(matchingIDs, id)
+		haveExisting = true
+		if existing.EventJSON.CreatedAt > maxCreatedAt {
+			maxCreatedAt = existing.EventJSON.CreatedAt
+		}
+	}
+	s.mu.Unlock()
+
+	if haveExisting && maxCreatedAt >= event.EventJSON.CreatedAt {
+		return nil
+	}
+
+	for _, id := range matchingIDs {
+		if err := s.Delete(id); err != nil {
+			return err
+		}
+	}
+	return s.Save(event)
+}
+
+// NewStoreFromFlag builds a Store from a -store flag value. "memory" (the
+// default) selects the in-memory ring buffer sized by dbSize; a
+// "sqlite:///path/to/relay.db" DSN selects the SQLite-backed store.
+func NewStoreFromFlag(value string, dbSize int, allow Filters) (Store, error) {
+	if value == "" || value == "memory" {
+		return NewMemoryStore(dbSize, allow), nil
+	}
+
+	if path, ok := strings.CutPrefix(value, "sqlite://"); ok {
+		return NewSQLiteStore(path, allow)
+	}
+
+	return nil, fmt.Errorf("unknown -store value: %v", value)
+}
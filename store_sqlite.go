@@ -0,0 +1,357 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteStore persists events to a SQLite database so a relay can restart
+// without losing state and hold datasets larger than RAM. It requires no
+// cgo since it's backed by modernc.org/sqlite.
+type sqliteStore struct {
+	db    *sql.DB
+	allow Filters
+}
+
+// NewSQLiteStore opens (and, if needed, migrates) a SQLite database at path.
+// allow restricts what Save will accept, same as NewMemoryStore, so
+// swapping -store doesn't silently change what the relay will persist.
+//
+// EVENT handling calls Save concurrently from many wsReceiver goroutines, so
+// the connection is pinned to a single pooled connection (serializing all
+// access) and opened with a busy_timeout and WAL journal mode, so a
+// contended write blocks briefly instead of failing with SQLITE_BUSY.
+func NewSQLiteStore(path string, allow Filters) (Store, error) {
+	dsn := path
+	if strings.Contains(dsn, "?") {
+		dsn += "&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	} else {
+		dsn += "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite db %v: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate sqlite db %v: %w", path, err)
+	}
+
+	return &sqliteStore{db: db, allow: allow}, nil
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS events (
+	id         TEXT PRIMARY KEY,
+	pubkey     TEXT NOT NULL,
+	kind       INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	raw_json   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_events_pubkey     ON events(pubkey);
+CREATE INDEX IF NOT EXISTS idx_events_kind       ON events(kind);
+CREATE INDEX IF NOT EXISTS idx_events_created_at ON events(created_at);
+
+CREATE TABLE IF NOT EXISTS event_tags (
+	event_id TEXT    NOT NULL,
+	name     TEXT    NOT NULL,
+	value    TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_event_tags_lookup ON event_tags(name, value);
+`
+
+func (s *sqliteStore) Save(event *Event) error {
+	if !s.allow.Match(event.EventJSON) {
+		return fmt.Errorf("event kind not allowed: %v", event.EventJSON.ID)
+	}
+
+	raw, err := json.Marshal(event.EventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event json: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`INSERT OR IGNORE INTO events (id, pubkey, kind, created_at, raw_json) VALUES (?, ?, ?, ?, ?)`,
+		event.EventJSON.ID, event.EventJSON.PubKey, event.EventJSON.Kind, event.EventJSON.CreatedAt, string(raw),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert event: %w", err)
+	}
+
+	for _, tag := range event.EventJSON.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		name := tag[0]
+		if len(name) != 1 {
+			continue
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO event_tags (event_id, name, value) VALUES (?, ?, ?)`,
+			event.EventJSON.ID, name, tag[1],
+		); err != nil {
+			return fmt.Errorf("failed to insert event tag: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteStore) FindAll(filters Filters) []*Event {
+	var found []*Event
+	s.Iterate(filters, func(event *Event) bool {
+		found = append(found, event)
+		return true
+	})
+	return found
+}
+
+func (s *sqliteStore) Iterate(filters Filters, fn func(*Event) bool) error {
+	query := `SELECT raw_json FROM events`
+	where, args := sqliteWhereForFilters(filters)
+	if where != "" {
+		query += ` WHERE ` + where
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return fmt.Errorf("failed to scan event row: %w", err)
+		}
+
+		var eventJSON EventJSON
+		if err := json.Unmarshal([]byte(raw), &eventJSON); err != nil {
+			return fmt.Errorf("failed to unmarshal event json: %w", err)
+		}
+
+		event := &Event{EventJSON: &eventJSON}
+		if !filters.Match(event.EventJSON) {
+			continue
+		}
+		if !fn(event) {
+			break
+		}
+	}
+	return rows.Err()
+}
+
+// Count reports cardinality without building a result slice. When filters
+// translates to an exact WHERE clause (see sqliteFiltersExact), SQLite counts
+// the rows directly via SELECT COUNT(*) ... WHERE; otherwise the WHERE
+// clause is only a superset match, so rows are streamed through
+// filters.Match and tallied instead, which still avoids materializing the
+// matching events.
+func (s *sqliteStore) Count(filters Filters) (int, error) {
+	if len(filters) == 0 || sqliteFiltersExact(filters) {
+		query := `SELECT COUNT(*) FROM events`
+		where, args := sqliteWhereForFilters(filters)
+		if where != "" {
+			query += ` WHERE ` + where
+		}
+
+		var n int
+		if err := s.db.QueryRow(query, args...).Scan(&n); err != nil {
+			return 0, fmt.Errorf("failed to count events: %w", err)
+		}
+		return n, nil
+	}
+
+	n := 0
+	if err := s.Iterate(filters, func(event *Event) bool {
+		n++
+		return true
+	}); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// sqliteWhereForFilters translates filters into a WHERE clause that can
+// use the id/pubkey/kind/created_at/tag indexes declared in sqliteSchema,
+// so a large dataset doesn't require a full table scan on every REQ or
+// COUNT. Each filter becomes a parenthesized AND-clause; filters within the
+// set are OR'd together, mirroring REQ's "any filter matches" semantics.
+// The result is a superset match — filters.Match is still applied per row
+// as the source of truth, since not every FilterJSON field is translated.
+func sqliteWhereForFilters(filters Filters) (string, []any) {
+	if len(filters) == 0 {
+		return "", nil
+	}
+
+	var clauses []string
+	var args []any
+	for _, filter := range filters {
+		clause, cArgs := sqliteWhereForFilter(filter.FilterJSON)
+		clauses = append(clauses, "("+clause+")")
+		args = append(args, cArgs...)
+	}
+	return strings.Join(clauses, " OR "), args
+}
+
+func sqliteWhereForFilter(fj *FilterJSON) (string, []any) {
+	if fj == nil {
+		return "1=1", nil
+	}
+
+	var conds []string
+	var args []any
+
+	if fj.IDs != nil && len(*fj.IDs) > 0 {
+		conds = append(conds, "id IN ("+sqlitePlaceholders(len(*fj.IDs))+")")
+		for _, id := range *fj.IDs {
+			args = append(args, id)
+		}
+	}
+	if fj.Authors != nil && len(*fj.Authors) > 0 {
+		conds = append(conds, "pubkey IN ("+sqlitePlaceholders(len(*fj.Authors))+")")
+		for _, author := range *fj.Authors {
+			args = append(args, author)
+		}
+	}
+	if fj.Kinds != nil && len(*fj.Kinds) > 0 {
+		conds = append(conds, "kind IN ("+sqlitePlaceholders(len(*fj.Kinds))+")")
+		for _, kind := range *fj.Kinds {
+			args = append(args, kind)
+		}
+	}
+	if fj.Since != nil {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, *fj.Since)
+	}
+	if fj.Until != nil {
+		conds = append(conds, "created_at <= ?")
+		args = append(args, *fj.Until)
+	}
+	for name, values := range fj.Tags {
+		if len(name) != 1 || len(values) == 0 {
+			continue
+		}
+		conds = append(conds, "id IN (SELECT event_id FROM event_tags WHERE name = ? AND value IN ("+sqlitePlaceholders(len(values))+"))")
+		args = append(args, name)
+		for _, value := range values {
+			args = append(args, value)
+		}
+	}
+
+	if len(conds) == 0 {
+		return "1=1", nil
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+func sqlitePlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// sqliteFiltersExact reports whether sqliteWhereForFilters translates every
+// filter in filters without dropping any field, meaning the WHERE clause
+// alone decides membership and Count can push COUNT(*) through it instead of
+// falling back to Iterate.
+func sqliteFiltersExact(filters Filters) bool {
+	for _, filter := range filters {
+		if !sqliteFilterIsExact(filter.FilterJSON) {
+			return false
+		}
+	}
+	return true
+}
+
+// sqliteFilterIsExact reports whether fj has no fields sqliteWhereForFilter
+// leaves untranslated. That function drops multi-letter tag names, tags with
+// no values, and empty ids/authors/kinds lists; Limit doesn't affect
+// membership, so it's irrelevant to Count either way.
+func sqliteFilterIsExact(fj *FilterJSON) bool {
+	if fj == nil {
+		return true
+	}
+	if (fj.IDs != nil && len(*fj.IDs) == 0) ||
+		(fj.Authors != nil && len(*fj.Authors) == 0) ||
+		(fj.Kinds != nil && len(*fj.Kinds) == 0) {
+		return false
+	}
+	for name, values := range fj.Tags {
+		if len(name) != 1 || len(values) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *sqliteStore) Delete(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM events WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete event: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM event_tags WHERE event_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete event tags: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ReplaceableUpsert keeps at most one event per (pubkey, kind). Save's
+// INSERT OR IGNORE only deduplicates by id, so more than one row can already
+// exist for a given (pubkey, kind) pair; this deletes every matching row
+// rather than assuming there's exactly one.
+func (s *sqliteStore) ReplaceableUpsert(event *Event) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var maxCreatedAt sql.NullInt64
+	if err := tx.QueryRow(
+		`SELECT MAX(created_at) FROM events WHERE pubkey = ? AND kind = ?`,
+		event.EventJSON.PubKey, event.EventJSON.Kind,
+	).Scan(&maxCreatedAt); err != nil {
+		return fmt.Errorf("failed to look up replaceable event: %w", err)
+	}
+
+	if maxCreatedAt.Valid && maxCreatedAt.Int64 >= event.EventJSON.CreatedAt {
+		return nil
+	}
+
+	if _, err := tx.Exec(
+		`DELETE FROM event_tags WHERE event_id IN (SELECT id FROM events WHERE pubkey = ? AND kind = ?)`,
+		event.EventJSON.PubKey, event.EventJSON.Kind,
+	); err != nil {
+		return fmt.Errorf("failed to delete superseded event tags: %w", err)
+	}
+	if _, err := tx.Exec(
+		`DELETE FROM events WHERE pubkey = ? AND kind = ?`,
+		event.EventJSON.PubKey, event.EventJSON.Kind,
+	); err != nil {
+		return fmt.Errorf("failed to delete superseded events: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tx: %w", err)
+	}
+
+	return s.Save(event)
+}
@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+// ":memory:" is private to whichever connection opened it, so this would be
+// flaky under database/sql's connection pooling if two queries ever landed
+// on different connections; NewSQLiteStore pins the pool to a single
+// connection (SetMaxOpenConns(1)), so these tests see the same in-memory
+// database on every query.
+func TestSQLiteStoreSaveFindAllCountDelete(t *testing.T) {
+	store, err := NewSQLiteStore(":memory:", DefaultFilters)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() error = %v", err)
+	}
+
+	event := &Event{
+		EventJSON: &EventJSON{
+			ID:        "deadbeef",
+			PubKey:    "pubkey1",
+			Kind:      1,
+			CreatedAt: 1000,
+			Tags:      [][]string{{"e", "otherid"}},
+		},
+	}
+
+	if err := store.Save(event); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	filters := Filters{&Filter{&FilterJSON{Kinds: &[]int{1}}}}
+
+	found := store.FindAll(filters)
+	if len(found) != 1 || found[0].EventJSON.ID != event.EventJSON.ID {
+		t.Fatalf("FindAll() = %v, want one event with id %v", found, event.EventJSON.ID)
+	}
+
+	count, err := store.Count(filters)
+	if err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("Count() = %v, want 1", count)
+	}
+
+	if err := store.Delete(event.EventJSON.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if found := store.FindAll(filters); len(found) != 0 {
+		t.Fatalf("FindAll() after delete = %v, want empty", found)
+	}
+}
+
+// See the SetMaxOpenConns(1) note on TestSQLiteStoreSaveFindAllCountDelete
+// for why ":memory:" is safe to use here.
+func TestSQLiteStoreReplaceableUpsertSupersedesOlder(t *testing.T) {
+	store, err := NewSQLiteStore(":memory:", DefaultFilters)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() error = %v", err)
+	}
+
+	older := &Event{EventJSON: &EventJSON{ID: "older", PubKey: "pubkey1", Kind: 0, CreatedAt: 1000}}
+	newer := &Event{EventJSON: &EventJSON{ID: "newer", PubKey: "pubkey1", Kind: 0, CreatedAt: 2000}}
+
+	if err := store.ReplaceableUpsert(older); err != nil {
+		t.Fatalf("ReplaceableUpsert(older) error = %v", err)
+	}
+	if err := store.ReplaceableUpsert(newer); err != nil {
+		t.Fatalf("ReplaceableUpsert(newer) error = %v", err)
+	}
+
+	filters := Filters{&Filter{&FilterJSON{Kinds: &[]int{0}}}}
+	found := store.FindAll(filters)
+	if len(found) != 1 || found[0].EventJSON.ID != newer.EventJSON.ID {
+		t.Fatalf("FindAll() = %v, want only the newer event", found)
+	}
+}